@@ -6,17 +6,23 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/pprof"
+	"os"
 	"strings"
 	"time"
 
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/credentials"
 	"gopkg.in/yaml.v3"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -48,6 +54,12 @@ type bucketOpts struct {
 	storage string
 	prefix  string
 
+	// configFile, when set, is read as an objstore.yaml-style config and
+	// passed to client.NewBucket verbatim, bypassing storage/prefix and the
+	// typed option groups below entirely. This is how providers without
+	// typed options here (OCI, COS, OSS, ...) get wired up.
+	configFile string
+
 	// filesystem options
 	filesystemDirectory string
 
@@ -58,10 +70,37 @@ type bucketOpts struct {
 	s3SecretKey string
 	s3Insecure  bool
 
+	// gcs options
+	gcsBucket             string
+	gcsServiceAccountFile string
+
+	// azure options
+	azureStorageAccount    string
+	azureStorageAccountKey string
+	azureContainer         string
+
+	// swift options
+	swiftAuthURL       string
+	swiftUsername      string
+	swiftPassword      string
+	swiftContainerName string
+
 	retries int
 }
 
 func setupBucket(log *slog.Logger, opts bucketOpts) (objstore.Bucket, error) {
+	if opts.configFile != "" {
+		bytes, err := os.ReadFile(opts.configFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bucket config file: %w", err)
+		}
+		bkt, err := client.NewBucket(slogAdapter{log}, bytes, "parquet-gateway", nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create bucket client: %w", err)
+		}
+		return bkt, nil
+	}
+
 	prov := objstore.ObjProvider(strings.ToUpper(opts.storage))
 	cfg := client.BucketConfig{
 		Type:   prov,
@@ -91,8 +130,46 @@ func setupBucket(log *slog.Logger, opts bucketOpts) (objstore.Bucket, error) {
 			Insecure:   opts.s3Insecure,
 			MaxRetries: opts.retries,
 		}
+	case objstore.GCS:
+		var serviceAccount string
+		if opts.gcsServiceAccountFile != "" {
+			b, err := os.ReadFile(opts.gcsServiceAccountFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read gcs service account file: %w", err)
+			}
+			serviceAccount = string(b)
+		}
+		subCfg = struct {
+			Bucket         string `yaml:"bucket"`
+			ServiceAccount string `yaml:"service_account"`
+		}{
+			Bucket:         opts.gcsBucket,
+			ServiceAccount: serviceAccount,
+		}
+	case objstore.AZURE:
+		subCfg = struct {
+			StorageAccount    string `yaml:"storage_account"`
+			StorageAccountKey string `yaml:"storage_account_key"`
+			Container         string `yaml:"container"`
+		}{
+			StorageAccount:    opts.azureStorageAccount,
+			StorageAccountKey: opts.azureStorageAccountKey,
+			Container:         opts.azureContainer,
+		}
+	case objstore.SWIFT:
+		subCfg = struct {
+			AuthUrl       string `yaml:"auth_url"`
+			Username      string `yaml:"username"`
+			Password      string `yaml:"password"`
+			ContainerName string `yaml:"container_name"`
+		}{
+			AuthUrl:       opts.swiftAuthURL,
+			Username:      opts.swiftUsername,
+			Password:      opts.swiftPassword,
+			ContainerName: opts.swiftContainerName,
+		}
 	default:
-		return nil, fmt.Errorf("unknown bucket type: %s", prov)
+		return nil, fmt.Errorf("unknown bucket type: %s, use a bucket config file for other objstore providers", prov)
 	}
 
 	cfg.Config = subCfg
@@ -122,10 +199,23 @@ type tracingOpts struct {
 	exporterType string
 
 	// jaeger opts
+	//
+	// Deprecated: Jaeger now ingests OTLP natively and upstream has
+	// deprecated this exporter. Use the OTLP exporter type instead.
 	jaegerEndpoint string
 
-	samplingParam float64
-	samplingType  string
+	// otlp opts
+	otlpProtocol    string // "grpc" or "http"
+	otlpEndpoint    string
+	otlpHeaders     map[string]string
+	otlpInsecure    bool
+	otlpCompression string // "none" or "gzip"
+	otlpCertFile    string
+	otlpKeyFile     string
+
+	samplingParam     float64
+	samplingType      string
+	samplingRateLimit float64 // spans/sec cap for RATE_LIMITED
 }
 
 func setupTracing(ctx context.Context, opts tracingOpts) error {
@@ -134,7 +224,13 @@ func setupTracing(ctx context.Context, opts tracingOpts) error {
 		err      error
 	)
 	switch opts.exporterType {
+	case "OTLP":
+		exporter, err = setupOTLPExporter(ctx, opts)
+		if err != nil {
+			return err
+		}
 	case "JAEGER":
+		// Deprecated: prefer the OTLP exporter, Jaeger ingests OTLP natively.
 		exporter, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(opts.jaegerEndpoint)))
 		if err != nil {
 			return err
@@ -151,6 +247,8 @@ func setupTracing(ctx context.Context, opts tracingOpts) error {
 	switch opts.samplingType {
 	case "PROBABILISTIC":
 		sampler = trace.TraceIDRatioBased(opts.samplingParam)
+	case "RATE_LIMITED":
+		sampler = newRateLimitedSampler(trace.TraceIDRatioBased(opts.samplingParam), opts.samplingRateLimit)
 	case "ALWAYS":
 		sampler = trace.AlwaysSample()
 	case "NEVER":
@@ -177,6 +275,83 @@ func setupTracing(ctx context.Context, opts tracingOpts) error {
 	return nil
 }
 
+func setupOTLPExporter(ctx context.Context, opts tracingOpts) (trace.SpanExporter, error) {
+	var tlsCfg *tls.Config
+	if opts.otlpCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.otlpCertFile, opts.otlpKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load otlp tls cert: %w", err)
+		}
+		tlsCfg = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	switch opts.otlpProtocol {
+	case "http":
+		httpOpts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(opts.otlpEndpoint),
+			otlptracehttp.WithHeaders(opts.otlpHeaders),
+		}
+		if opts.otlpInsecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		if tlsCfg != nil {
+			httpOpts = append(httpOpts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+		}
+		if opts.otlpCompression == "gzip" {
+			httpOpts = append(httpOpts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		return otlptracehttp.New(ctx, httpOpts...)
+	case "grpc":
+		grpcOpts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(opts.otlpEndpoint),
+			otlptracegrpc.WithHeaders(opts.otlpHeaders),
+		}
+		if opts.otlpInsecure {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+		} else if tlsCfg != nil {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		}
+		if opts.otlpCompression == "gzip" {
+			grpcOpts = append(grpcOpts, otlptracegrpc.WithCompressor("gzip"))
+		}
+		return otlptracegrpc.New(ctx, grpcOpts...)
+	default:
+		return nil, fmt.Errorf("invalid otlp protocol %s, must be grpc or http", opts.otlpProtocol)
+	}
+}
+
+// rateLimitedSampler combines a ratio-based sampling decision with a
+// token-bucket cap so a probabilistic sample of high-cardinality PromQL
+// traffic can't overwhelm the collector: traces are ratio-sampled as usual,
+// but even a sampled trace is dropped once the process-wide span budget for
+// the current second is spent.
+type rateLimitedSampler struct {
+	ratio   trace.Sampler
+	limiter *rate.Limiter
+}
+
+func newRateLimitedSampler(ratio trace.Sampler, spansPerSecond float64) *rateLimitedSampler {
+	return &rateLimitedSampler{
+		ratio:   ratio,
+		limiter: rate.NewLimiter(rate.Limit(spansPerSecond), int(spansPerSecond)+1),
+	}
+}
+
+func (s *rateLimitedSampler) ShouldSample(params trace.SamplingParameters) trace.SamplingResult {
+	res := s.ratio.ShouldSample(params)
+	if res.Decision != trace.RecordAndSample {
+		return res
+	}
+	if !s.limiter.Allow() {
+		res.Decision = trace.Drop
+	}
+	return res
+}
+
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimitedSampler{%s}", s.ratio.Description())
+}
+
 type apiOpts struct {
 	port int
 
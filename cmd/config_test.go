@@ -0,0 +1,49 @@
+// Copyright (c) 2025 Cloudflare, Inc.
+// Licensed under the Apache 2.0 license found in the LICENSE file or at:
+//     https://opensource.org/licenses/Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRateLimitedSampler_DropsOnceCapExceeded(t *testing.T) {
+	const spansPerSecond = 2
+	s := newRateLimitedSampler(trace.AlwaysSample(), spansPerSecond)
+	params := trace.SamplingParameters{ParentContext: context.Background()}
+
+	var sampled, dropped int
+	for range spansPerSecond * 10 {
+		switch s.ShouldSample(params).Decision {
+		case trace.RecordAndSample:
+			sampled++
+		case trace.Drop:
+			dropped++
+		}
+	}
+
+	if sampled == 0 {
+		t.Fatalf("expected the burst allowance to let some spans through, got none sampled")
+	}
+	if dropped == 0 {
+		t.Fatalf("expected the limiter to drop spans once the %v spans/sec cap was exceeded, got none dropped", spansPerSecond)
+	}
+}
+
+func TestRateLimitedSampler_PassesThroughNonSampleDecisions(t *testing.T) {
+	s := newRateLimitedSampler(trace.NeverSample(), 1)
+	params := trace.SamplingParameters{ParentContext: context.Background()}
+
+	// The rate limiter must only gate a decision that was already going to
+	// be RecordAndSample -- it shouldn't turn a ratio sampler's Drop into
+	// anything else, and it shouldn't consume limiter budget for it either.
+	for range 3 {
+		if res := s.ShouldSample(params); res.Decision != trace.Drop {
+			t.Fatalf("expected NeverSample's decision to pass through unchanged, got %v", res.Decision)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache 2.0 license found in the LICENSE file or at:
+//     https://opensource.org/licenses/Apache-2.0
+
+package convert
+
+import (
+	"fmt"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/thanos-io/thanos-parquet-gateway/schema"
+)
+
+// BloomFilterColumns requests split-block bloom filters on the given label
+// columns of the labels parquet file, e.g. "__name__", "instance", "pod".
+// TSDB index readers lean heavily on posting-list equality lookups for label
+// matchers, and a bloom filter would let the query path in locate
+// short-circuit a row-group read entirely when a matcher's value is
+// provably absent -- but that's write-side only: nothing in locate reads
+// these filters back yet, so until that consumer lands this only grows the
+// labels file without speeding up any query. Wiring locate up to check
+// ColumnChunk.BloomFilter() before a row-group read is a follow-up.
+//
+// bitsPerValue controls the false-positive rate of the filter, same
+// trade-off as parquet-go's own BloomFilters writer option. Calling this
+// more than once adds to the columns already requested, and the last call's
+// bitsPerValue applies to all of them.
+func BloomFilterColumns(columns []string, bitsPerValue int) ConvertOption {
+	return func(o *convertOpts) error {
+		if bitsPerValue <= 0 {
+			return fmt.Errorf("bitsPerValue must be positive, got %d", bitsPerValue)
+		}
+		for _, col := range columns {
+			o.bloomFilterColumns = append(o.bloomFilterColumns, schema.LabelNameToColumn(col))
+		}
+		o.bloomFilterBitsPerValue = bitsPerValue
+		return nil
+	}
+}
+
+// bloomFilterWriterOptions turns the requested label columns into the
+// parquet-go BloomFilters writer option, one SplitBlockFilter per column.
+func bloomFilterWriterOptions(columns []string, bitsPerValue int) []parquet.WriterOption {
+	if len(columns) == 0 {
+		return nil
+	}
+	filters := make([]parquet.BloomFilterColumn, 0, len(columns))
+	for _, col := range columns {
+		filters = append(filters, parquet.SplitBlockFilter(bitsPerValue, col))
+	}
+	return []parquet.WriterOption{parquet.BloomFilters(filters...)}
+}
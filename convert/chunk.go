@@ -0,0 +1,98 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache 2.0 license found in the LICENSE file or at:
+//     https://opensource.org/licenses/Apache-2.0
+
+package convert
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// ChunkType discriminates the kind of samples encoded in a raw TSDB chunk
+// column so the query path can hand the bytes back to the right
+// chunkenc.Chunk implementation without re-inspecting the payload.
+type ChunkType uint8
+
+const (
+	ChunkTypeFloat ChunkType = iota
+	ChunkTypeHistogram
+	ChunkTypeFloatHistogram
+
+	// Aggregate chunk types written for a downsampled Resolution. Each one
+	// is always a plain XOR chunk of one point per aggregation window; see
+	// downsample.go.
+	ChunkTypeAggrCount
+	ChunkTypeAggrSum
+	ChunkTypeAggrMin
+	ChunkTypeAggrMax
+	ChunkTypeAggrCounter
+)
+
+func chunkTypeForEncoding(enc chunkenc.Encoding) (ChunkType, error) {
+	switch enc {
+	case chunkenc.EncXOR:
+		return ChunkTypeFloat, nil
+	case chunkenc.EncHistogram:
+		return ChunkTypeHistogram, nil
+	case chunkenc.EncFloatHistogram:
+		return ChunkTypeFloatHistogram, nil
+	default:
+		return 0, fmt.Errorf("unsupported chunk encoding: %s", enc)
+	}
+}
+
+// encodeChunk prefixes the raw chunk bytes with a one byte discriminator so
+// that native/sparse histogram chunks -- custom bucket layouts, the zero
+// bucket, and the positive/negative spans and deltas included -- survive the
+// parquet round trip unchanged, right alongside plain float chunks.
+func encodeChunk(c chunkenc.Chunk) ([]byte, error) {
+	typ, err := chunkTypeForEncoding(c.Encoding())
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode chunk: %w", err)
+	}
+	raw := c.Bytes()
+	buf := make([]byte, 1+len(raw))
+	buf[0] = byte(typ)
+	copy(buf[1:], raw)
+	return buf, nil
+}
+
+// encodeAggrChunk is encodeChunk for the five synthetic per-window aggregate
+// chunks a downsampled Resolution writes: they're always XOR chunks, but
+// still carry the discriminator so decodeChunk can tell a `sum` aggregate
+// from a `count` aggregate in the same chunk column.
+func encodeAggrChunk(typ ChunkType, c chunkenc.Chunk) ([]byte, error) {
+	switch typ {
+	case ChunkTypeAggrCount, ChunkTypeAggrSum, ChunkTypeAggrMin, ChunkTypeAggrMax, ChunkTypeAggrCounter:
+	default:
+		return nil, fmt.Errorf("not an aggregate chunk type: %d", typ)
+	}
+	raw := c.Bytes()
+	buf := make([]byte, 1+len(raw))
+	buf[0] = byte(typ)
+	copy(buf[1:], raw)
+	return buf, nil
+}
+
+// decodeChunk is the inverse of encodeChunk/encodeAggrChunk. It is used by
+// the query path to turn a chunk column value back into a chunkenc.Chunk,
+// whether that chunk holds float samples, a native histogram, or one of the
+// five downsampled aggregates (which are always XOR-encoded).
+func decodeChunk(b []byte) (chunkenc.Chunk, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty chunk column value")
+	}
+	typ, raw := ChunkType(b[0]), b[1:]
+	switch typ {
+	case ChunkTypeFloat, ChunkTypeAggrCount, ChunkTypeAggrSum, ChunkTypeAggrMin, ChunkTypeAggrMax, ChunkTypeAggrCounter:
+		return chunkenc.FromData(chunkenc.EncXOR, raw)
+	case ChunkTypeHistogram:
+		return chunkenc.FromData(chunkenc.EncHistogram, raw)
+	case ChunkTypeFloatHistogram:
+		return chunkenc.FromData(chunkenc.EncFloatHistogram, raw)
+	default:
+		return nil, fmt.Errorf("unknown chunk type discriminator: %d", typ)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache 2.0 license found in the LICENSE file or at:
+//     https://opensource.org/licenses/Apache-2.0
+
+package convert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+
+	"github.com/thanos-io/thanos-parquet-gateway/schema"
+)
+
+// Convertible is anything ConvertTSDBBlock can read series out of -- a TSDB
+// Head and a persisted Block both satisfy this.
+type Convertible interface {
+	Index() (tsdb.IndexReader, error)
+	Chunks() (tsdb.ChunkReader, error)
+	Meta() tsdb.BlockMeta
+}
+
+// convertOpts holds the tunables that control how ConvertTSDBBlock lays out
+// the resulting parquet files. Use the ConvertOption constructors below to
+// set them; defaultConvertOpts is the converter's default behaviour.
+type convertOpts struct {
+	sortBy []string
+
+	rowGroupSize        int
+	rowGroupCount       int
+	labelPageBufferSize units.Base2Bytes
+
+	resolution Resolution
+
+	bloomFilterColumns      []string
+	bloomFilterBitsPerValue int
+}
+
+// ConvertOption configures the converter. Options are applied in order, so
+// later options win if they set the same field; BloomFilterColumns is the
+// exception and adds to the columns requested by earlier calls.
+type ConvertOption func(*convertOpts) error
+
+// SortBy orders the series written to the labels/chunks files by the given
+// label names, most significant first. Series missing a requested label sort
+// as if it were empty.
+func SortBy(labelNames ...string) ConvertOption {
+	return func(o *convertOpts) error {
+		o.sortBy = labelNames
+		return nil
+	}
+}
+
+// RowGroupSize caps the number of rows written into a single parquet row
+// group.
+func RowGroupSize(n int) ConvertOption {
+	return func(o *convertOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("row group size must be positive, got %d", n)
+		}
+		o.rowGroupSize = n
+		return nil
+	}
+}
+
+// RowGroupCount splits the series across at most this many label/chunk file
+// shards of equal size; the last shard may be smaller, and there are fewer
+// shards when the series don't fill them all.
+func RowGroupCount(n int) ConvertOption {
+	return func(o *convertOpts) error {
+		if n <= 0 {
+			return fmt.Errorf("row group count must be positive, got %d", n)
+		}
+		o.rowGroupCount = n
+		return nil
+	}
+}
+
+// LabelPageBufferSize sets the page buffer size used when writing label
+// columns, trading memory for how many pages a label column ends up with.
+func LabelPageBufferSize(sz units.Base2Bytes) ConvertOption {
+	return func(o *convertOpts) error {
+		o.labelPageBufferSize = sz
+		return nil
+	}
+}
+
+func defaultConvertOpts() *convertOpts {
+	return &convertOpts{
+		rowGroupSize:        1_000_000,
+		rowGroupCount:       1,
+		labelPageBufferSize: units.MiB,
+	}
+}
+
+// seriesEntry is one series worth of converted data: its labels and its
+// already chunk-column-encoded chunks (see chunk.go), ready to be written
+// into a row of the labels/chunks parquet files.
+type seriesEntry struct {
+	lbls   labels.Labels
+	chunks [][]byte
+}
+
+// ConvertTSDBBlock reads every series out of blocks and writes them as a
+// sharded pair of labels/chunks parquet files into bkt, named after day.
+func ConvertTSDBBlock(ctx context.Context, bkt objstore.Bucket, day time.Time, blocks []Convertible, opts ...ConvertOption) error {
+	o := defaultConvertOpts()
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return fmt.Errorf("unable to apply convert option: %w", err)
+		}
+	}
+
+	var all []seriesEntry
+	for _, b := range blocks {
+		se, err := collectSeries(ctx, b, o)
+		if err != nil {
+			return fmt.Errorf("unable to collect series: %w", err)
+		}
+		all = append(all, se...)
+	}
+
+	sortSeries(all, o.sortBy)
+	shards := shardSeries(all, o.rowGroupCount)
+
+	blockName := schema.BlockNameForDayAndResolution(day, time.Duration(o.resolution))
+
+	for i, shard := range shards {
+		// Each shard's labels file only gets the label columns its own series
+		// carry, so no column in it is entirely null.
+		labelNames := labelNameUnion(shard)
+		if err := writeLabelsFile(ctx, bkt, blockName, i, shard, labelNames, o); err != nil {
+			return fmt.Errorf("unable to write labels file for shard %d: %w", i, err)
+		}
+		if err := writeChunksFile(ctx, bkt, blockName, i, shard, o); err != nil {
+			return fmt.Errorf("unable to write chunks file for shard %d: %w", i, err)
+		}
+	}
+
+	return schema.WriteMeta(ctx, bkt, schema.Meta{
+		Name:       blockName,
+		Shards:     len(shards),
+		Resolution: time.Duration(o.resolution),
+	})
+}
+
+// collectSeries reads every series out of a single Convertible. For
+// ResolutionRaw it encodes each chunk -- float and native/float histogram
+// chunks alike -- via encodeChunk unchanged; for a downsampled Resolution it
+// aggregates the series' chunks into that resolution's windows via
+// downsampleChunks instead, so the type discriminator travels with the
+// raw bytes all the way into the parquet file.
+func collectSeries(ctx context.Context, c Convertible, o *convertOpts) ([]seriesEntry, error) {
+	ix, err := c.Index()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get index reader: %w", err)
+	}
+	defer ix.Close()
+
+	cr, err := c.Chunks()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get chunk reader: %w", err)
+	}
+	defer cr.Close()
+
+	name, value := index.AllPostingsKey()
+	p, err := ix.Postings(ctx, name, value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get postings: %w", err)
+	}
+	p = ix.SortedPostings(p)
+
+	var (
+		out     []seriesEntry
+		builder labels.ScratchBuilder
+		chks    []chunks.Meta
+	)
+	for p.Next() {
+		chks = chks[:0]
+		if err := ix.Series(p.At(), &builder, &chks); err != nil {
+			return nil, fmt.Errorf("unable to read series %d: %w", p.At(), err)
+		}
+
+		raw := make([]chunkenc.Chunk, 0, len(chks))
+		for _, cm := range chks {
+			chk, err := cr.Chunk(cm)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read chunk: %w", err)
+			}
+			raw = append(raw, chk)
+		}
+
+		var encoded [][]byte
+		if o.resolution == ResolutionRaw {
+			encoded = make([][]byte, 0, len(raw))
+			for _, chk := range raw {
+				b, err := encodeChunk(chk)
+				if err != nil {
+					return nil, fmt.Errorf("unable to encode chunk: %w", err)
+				}
+				encoded = append(encoded, b)
+			}
+		} else {
+			if !allFloatChunks(raw) {
+				// Native histograms aren't supported by downsampling, same
+				// as Thanos' compactor: skip this series for this
+				// resolution tier rather than failing the whole block.
+				continue
+			}
+			encoded, err = downsampleChunks(raw, time.Duration(o.resolution))
+			if err != nil {
+				return nil, fmt.Errorf("unable to downsample series: %w", err)
+			}
+		}
+
+		out = append(out, seriesEntry{lbls: builder.Labels().Copy(), chunks: encoded})
+	}
+	if p.Err() != nil {
+		return nil, fmt.Errorf("postings iteration error: %w", p.Err())
+	}
+	return out, nil
+}
+
+func sortSeries(series []seriesEntry, sortBy []string) {
+	if len(sortBy) == 0 {
+		sortBy = []string{labels.MetricName}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		for _, name := range sortBy {
+			vi, vj := series[i].lbls.Get(name), series[j].lbls.Get(name)
+			if vi != vj {
+				return vi < vj
+			}
+		}
+		return false
+	})
+}
+
+func labelNameUnion(series []seriesEntry) []string {
+	set := make(map[string]struct{})
+	for _, se := range series {
+		se.lbls.Range(func(l labels.Label) {
+			set[l.Name] = struct{}{}
+		})
+	}
+	names := make([]string, 0, len(set))
+	for n := range set {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shardSeries splits the already-sorted series into n contiguous shards so
+// that every shard's label columns stay sorted, same as the whole.
+func shardSeries(series []seriesEntry, n int) [][]seriesEntry {
+	if n <= 1 || len(series) == 0 {
+		return [][]seriesEntry{series}
+	}
+	per := (len(series) + n - 1) / n
+	var shards [][]seriesEntry
+	for lo := 0; lo < len(series); lo += per {
+		hi := lo + per
+		if hi > len(series) {
+			hi = len(series)
+		}
+		shards = append(shards, series[lo:hi])
+	}
+	return shards
+}
+
+func writeLabelsFile(ctx context.Context, bkt objstore.Bucket, blockName string, shardIdx int, series []seriesEntry, labelNames []string, o *convertOpts) error {
+	group := parquet.Group{
+		schema.LabelIndexColumn: parquet.Leaf(parquet.Int64Type),
+	}
+	for _, name := range labelNames {
+		group[schema.LabelNameToColumn(name)] = parquet.Optional(parquet.String())
+	}
+	sch := parquet.NewSchema("labels", group)
+
+	writerOpts := []parquet.WriterOption{
+		sch,
+		parquet.PageBufferSize(int64(o.labelPageBufferSize)),
+		parquet.MaxRowsPerRowGroup(int64(o.rowGroupSize)),
+	}
+	writerOpts = append(writerOpts, bloomFilterWriterOptions(o.bloomFilterColumns, o.bloomFilterBitsPerValue)...)
+
+	buf := bytes.NewBuffer(nil)
+	w := parquet.NewWriter(buf, writerOpts...)
+	for i, se := range series {
+		row := map[string]any{schema.LabelIndexColumn: int64(i)}
+		se.lbls.Range(func(l labels.Label) {
+			row[schema.LabelNameToColumn(l.Name)] = l.Value
+		})
+		if _, err := w.Write(row); err != nil {
+			return fmt.Errorf("unable to write label row: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to close labels writer: %w", err)
+	}
+	return bkt.Upload(ctx, schema.LabelsPfileNameForShard(blockName, shardIdx), buf)
+}
+
+func writeChunksFile(ctx context.Context, bkt objstore.Bucket, blockName string, shardIdx int, series []seriesEntry, o *convertOpts) error {
+	sch := parquet.NewSchema("chunks", parquet.Group{
+		schema.ChunkColumn: parquet.Repeated(parquet.Leaf(parquet.ByteArrayType)),
+	})
+
+	buf := bytes.NewBuffer(nil)
+	w := parquet.NewWriter(buf, sch, parquet.MaxRowsPerRowGroup(int64(o.rowGroupSize)))
+	for _, se := range series {
+		if _, err := w.Write(map[string]any{schema.ChunkColumn: se.chunks}); err != nil {
+			return fmt.Errorf("unable to write chunk row: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to close chunks writer: %w", err)
+	}
+	return bkt.Upload(ctx, schema.ChunksPfileNameForShard(blockName, shardIdx), buf)
+}
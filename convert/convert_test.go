@@ -17,7 +17,9 @@ import (
 
 	"github.com/alecthomas/units"
 	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/util/teststorage"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/providers/filesystem"
@@ -115,6 +117,551 @@ func TestConverter(t *testing.T) {
 	}
 }
 
+func TestConverter_Downsampling(t *testing.T) {
+	st := teststorage.New(t)
+	t.Cleanup(func() { _ = st.Close() })
+
+	bkt, err := filesystem.NewBucket(t.TempDir())
+	if err != nil {
+		t.Fatalf("unable to create bucket: %s", err)
+	}
+	t.Cleanup(func() { _ = bkt.Close() })
+
+	app := st.Appender(t.Context())
+	lbls := labels.FromStrings("__name__", "requests_total")
+	// 20 samples 30s apart span two full 5m windows (0-9 in [0,300s), 10-19
+	// in [300s,600s)), with a counter reset at the start of the second
+	// window so the reset-correction also gets exercised end to end.
+	samples := windowedCounterSamples()
+	for i, v := range samples {
+		ts := time.Duration(i) * 30 * time.Second
+		if _, err := app.Append(0, lbls, ts.Milliseconds(), v); err != nil {
+			t.Fatalf("unable to append sample: %s", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatalf("unable to commit samples: %s", err)
+	}
+
+	h := st.Head()
+	d := util.BeginOfDay(time.UnixMilli(h.MinTime())).UTC()
+
+	rawOpts := []ConvertOption{SortBy(labels.MetricName)}
+	if err := ConvertTSDBBlock(t.Context(), bkt, d, []Convertible{h}, rawOpts...); err != nil {
+		t.Fatalf("unable to convert raw tsdb block: %s", err)
+	}
+
+	downsampledOpts := []ConvertOption{SortBy(labels.MetricName), ResolutionOption(Resolution5m)}
+	if err := ConvertTSDBBlock(t.Context(), bkt, d, []Convertible{h}, downsampledOpts...); err != nil {
+		t.Fatalf("unable to convert 5m tsdb block: %s", err)
+	}
+
+	discoverer := locate.NewDiscoverer(bkt)
+	if err := discoverer.Discover(t.Context()); err != nil {
+		t.Fatalf("unable to discover converted blocks: %s", err)
+	}
+	metas := discoverer.Metas()
+	if n := len(metas); n != 2 {
+		t.Fatalf("expected a raw and a 5m block, got %d metas", n)
+	}
+
+	var downsampledMeta *locate.BlockMeta
+	for _, m := range metas {
+		if time.Duration(m.Resolution) == 5*time.Minute {
+			m := m
+			downsampledMeta = &m
+		}
+	}
+	if downsampledMeta == nil {
+		t.Fatalf("did not find a 5m resolution meta among: %+v", metas)
+	}
+
+	cf, err := loadParquetFile(t.Context(), bkt, schema.ChunksPfileNameForShard(downsampledMeta.Name, 0))
+	if err != nil {
+		t.Fatalf("unable to load 5m chunk parquet file: %s", err)
+	}
+	gotCount, gotSum, gotMin, gotMax, gotCounter := readAggrWindows(t, cf)
+
+	wantCount := []float64{10, 10}
+	wantSum := []float64{sumOf(samples[:10]), sumOf(samples[10:])}
+	wantMin := []float64{0, 5}
+	wantMax := []float64{90, 95}
+	wantCounter := []float64{90, 90 + 95}
+
+	if !slices.Equal(gotCount, wantCount) {
+		t.Fatalf("unexpected count windows: got %v, want %v", gotCount, wantCount)
+	}
+	if !slices.Equal(gotSum, wantSum) {
+		t.Fatalf("unexpected sum windows: got %v, want %v", gotSum, wantSum)
+	}
+	if !slices.Equal(gotMin, wantMin) {
+		t.Fatalf("unexpected min windows: got %v, want %v", gotMin, wantMin)
+	}
+	if !slices.Equal(gotMax, wantMax) {
+		t.Fatalf("unexpected max windows: got %v, want %v", gotMax, wantMax)
+	}
+	if !slices.Equal(gotCounter, wantCounter) {
+		t.Fatalf("unexpected reset-corrected counter windows: got %v, want %v", gotCounter, wantCounter)
+	}
+}
+
+// TestConverter_DownsamplingSkipsIncompatibleSeries checks that converting a
+// block containing both a native histogram series and a float series at a
+// non-raw resolution skips the histogram series -- which downsampling
+// doesn't support -- instead of failing the whole block.
+func TestConverter_DownsamplingSkipsIncompatibleSeries(t *testing.T) {
+	st := teststorage.New(t)
+	t.Cleanup(func() { _ = st.Close() })
+
+	bkt, err := filesystem.NewBucket(t.TempDir())
+	if err != nil {
+		t.Fatalf("unable to create bucket: %s", err)
+	}
+	t.Cleanup(func() { _ = bkt.Close() })
+
+	app := st.Appender(t.Context())
+	for i := range 5 {
+		ts := (time.Duration(i) * 30 * time.Second).Milliseconds()
+		if _, err := app.Append(0, labels.FromStrings("__name__", "float_series"), ts, float64(i)); err != nil {
+			t.Fatalf("unable to append float sample: %s", err)
+		}
+		if _, err := app.AppendHistogram(0, labels.FromStrings("__name__", "histogram_series"), ts, tsdbutilHistogram(i), nil); err != nil {
+			t.Fatalf("unable to append histogram sample: %s", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatalf("unable to commit samples: %s", err)
+	}
+
+	h := st.Head()
+	d := util.BeginOfDay(time.UnixMilli(h.MinTime())).UTC()
+
+	opts := []ConvertOption{SortBy(labels.MetricName), ResolutionOption(Resolution5m)}
+	if err := ConvertTSDBBlock(t.Context(), bkt, d, []Convertible{h}, opts...); err != nil {
+		t.Fatalf("converting a block with a histogram series at a non-raw resolution should skip it, not fail: %s", err)
+	}
+
+	discoverer := locate.NewDiscoverer(bkt)
+	if err := discoverer.Discover(t.Context()); err != nil {
+		t.Fatalf("unable to discover converted block: %s", err)
+	}
+	metas := discoverer.Metas()
+	if n := len(metas); n != 1 {
+		t.Fatalf("expected a single 5m meta, got %d", n)
+	}
+	meta := metas[slices.Collect(maps.Keys(metas))[0]]
+
+	cf, err := loadParquetFile(t.Context(), bkt, schema.ChunksPfileNameForShard(meta.Name, 0))
+	if err != nil {
+		t.Fatalf("unable to load 5m chunk parquet file: %s", err)
+	}
+	rdr := parquet.NewGenericReader[chunkRow](cf)
+	defer rdr.Close()
+	rows := make([]chunkRow, rdr.NumRows())
+	if _, err := rdr.Read(rows); err != nil && err != io.EOF {
+		t.Fatalf("unable to read chunk rows: %s", err)
+	}
+	if n := len(rows); n != 1 {
+		t.Fatalf("expected only the float series to survive downsampling, got %d rows", n)
+	}
+}
+
+// windowedCounterSamples is 20 points 30s apart: a counter climbing 0..90 in
+// the first 5m window, then resetting and climbing 5..95 in the second.
+func windowedCounterSamples() []float64 {
+	samples := make([]float64, 0, 20)
+	for i := range 10 {
+		samples = append(samples, float64(i*10))
+	}
+	for i := range 10 {
+		samples = append(samples, float64(i*10+5))
+	}
+	return samples
+}
+
+func sumOf(vs []float64) float64 {
+	var s float64
+	for _, v := range vs {
+		s += v
+	}
+	return s
+}
+
+// readAggrWindows decodes the single downsampled series' five aggregate
+// chunks out of a chunks parquet file and returns each as the sequence of
+// per-window values it holds.
+func readAggrWindows(t *testing.T, pf *parquet.File) (count, sum, min, max, counter []float64) {
+	t.Helper()
+
+	rdr := parquet.NewGenericReader[chunkRow](pf)
+	defer rdr.Close()
+
+	rows := make([]chunkRow, rdr.NumRows())
+	if _, err := rdr.Read(rows); err != nil && err != io.EOF {
+		t.Fatalf("unable to read chunk rows: %s", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected exactly one series, got %d rows", len(rows))
+	}
+	if len(rows[0].Chunks) != 5 {
+		t.Fatalf("expected 5 aggregate chunks, got %d", len(rows[0].Chunks))
+	}
+
+	values := func(raw []byte) []float64 {
+		c, err := decodeChunk(raw)
+		if err != nil {
+			t.Fatalf("unable to decode aggregate chunk: %s", err)
+		}
+		var vs []float64
+		it := c.Iterator(nil)
+		for it.Next() == chunkenc.ValFloat {
+			_, v := it.At()
+			vs = append(vs, v)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("unable to iterate aggregate chunk: %s", err)
+		}
+		return vs
+	}
+
+	for _, raw := range rows[0].Chunks {
+		typ := ChunkType(raw[0])
+		vs := values(raw)
+		switch typ {
+		case ChunkTypeAggrCount:
+			count = vs
+		case ChunkTypeAggrSum:
+			sum = vs
+		case ChunkTypeAggrMin:
+			min = vs
+		case ChunkTypeAggrMax:
+			max = vs
+		case ChunkTypeAggrCounter:
+			counter = vs
+		}
+	}
+	return count, sum, min, max, counter
+}
+
+// TestDownsampleAppender exercises the aggregation windowing and counter
+// reset correction directly, independent of the parquet encoding path.
+func TestDownsampleAppender(t *testing.T) {
+	da := newDownsampleAppender(5*time.Minute, 0)
+
+	// 20 samples 30s apart span two full 5m windows (ts 0..270000ms is the
+	// first window, 300000..570000ms the second), with a counter reset at
+	// the window boundary.
+	samples := windowedCounterSamples()
+	var windows []*aggrWindow
+	for i, v := range samples {
+		ts := time.Duration(i) * 30 * time.Second
+		if w := da.Add(ts.Milliseconds(), v); w != nil {
+			windows = append(windows, w)
+		}
+	}
+	if w := da.Flush(); w != nil {
+		windows = append(windows, w)
+	}
+
+	if n := len(windows); n != 2 {
+		t.Fatalf("expected 2 windows, got %d", n)
+	}
+
+	first, second := windows[0], windows[1]
+	if first.count != 10 || first.sum != sumOf(samples[:10]) || first.min != 0 || first.max != 90 {
+		t.Fatalf("unexpected first window aggregates: %+v", first)
+	}
+	if first.counter != 90 {
+		t.Fatalf("expected first window counter to be 90, got %v", first.counter)
+	}
+	if second.count != 10 || second.sum != sumOf(samples[10:]) || second.min != 5 || second.max != 95 {
+		t.Fatalf("unexpected second window aggregates: %+v", second)
+	}
+	// The counter dropped from 90 to 5 across the reset: the aggregated
+	// counter must keep climbing past the pre-reset high-water mark.
+	if second.counter != 90+95 {
+		t.Fatalf("expected reset-corrected counter to be %v, got %v", 90+95, second.counter)
+	}
+}
+
+func TestConverter_NativeHistograms(t *testing.T) {
+	st := teststorage.New(t)
+	t.Cleanup(func() { _ = st.Close() })
+
+	bkt, err := filesystem.NewBucket(t.TempDir())
+	if err != nil {
+		t.Fatalf("unable to create bucket: %s", err)
+	}
+	t.Cleanup(func() { _ = bkt.Close() })
+
+	app := st.Appender(t.Context())
+
+	for i := range 10 {
+		ts := time.Second.Milliseconds() * int64(i+1)
+
+		fh := tsdbutilFloatHistogram(i)
+		h := tsdbutilHistogram(i)
+
+		if _, err := app.AppendHistogram(0, labels.FromStrings("__name__", "native_histogram"), ts, h, nil); err != nil {
+			t.Fatalf("unable to append histogram sample: %s", err)
+		}
+		if _, err := app.AppendHistogram(0, labels.FromStrings("__name__", "native_float_histogram"), ts, nil, fh); err != nil {
+			t.Fatalf("unable to append float histogram sample: %s", err)
+		}
+		if _, err := app.Append(0, labels.FromStrings("__name__", "float_series"), ts, float64(i)); err != nil {
+			t.Fatalf("unable to append float sample: %s", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatalf("unable to commit samples: %s", err)
+	}
+
+	h := st.Head()
+	d := util.BeginOfDay(time.UnixMilli(h.MinTime())).UTC()
+
+	opts := []ConvertOption{
+		SortBy(labels.MetricName),
+		RowGroupSize(250),
+	}
+	if err := ConvertTSDBBlock(t.Context(), bkt, d, []Convertible{h}, opts...); err != nil {
+		t.Fatalf("unable to convert tsdb block: %s", err)
+	}
+
+	discoverer := locate.NewDiscoverer(bkt)
+	if err := discoverer.Discover(t.Context()); err != nil {
+		t.Fatalf("unable to discover converted block: %s", err)
+	}
+	metas := discoverer.Metas()
+	if n := len(metas); n != 1 {
+		t.Fatalf("unexpected number of metas: %d", n)
+	}
+	meta := metas[slices.Collect(maps.Keys(metas))[0]]
+
+	// Rows come out sorted by __name__: "float_series" < "native_float_histogram" < "native_histogram".
+	wantKinds := []chunkRowKind{chunkRowKindFloat, chunkRowKindFloatHistogram, chunkRowKindHistogram}
+	for i := range int(meta.Shards) {
+		cf, err := loadParquetFile(t.Context(), bkt, schema.ChunksPfileNameForShard(meta.Name, i))
+		if err != nil {
+			t.Fatalf("unable to load chunk parquet file for shard %d: %s", i, err)
+		}
+		if err := hasLosslessChunkRoundtrip(cf, wantKinds); err != nil {
+			t.Fatalf("chunks did not round-trip losslessly for shard %d: %s", i, err)
+		}
+	}
+}
+
+// tsdbutilHistogram builds a deterministic native histogram with custom
+// bucket layouts, a zero bucket and positive/negative spans and deltas, so
+// the round-trip assertion below actually exercises the sparse encoding.
+func tsdbutilHistogram(i int) *histogram.Histogram {
+	return &histogram.Histogram{
+		Schema:        1,
+		Count:         uint64(7 * (i + 1)), // zero bucket plus every positive and negative bucket below
+		Sum:           18.4 * float64(i+1),
+		ZeroThreshold: 0.001,
+		ZeroCount:     uint64(i),
+		PositiveSpans: []histogram.Span{
+			{Offset: 0, Length: 2},
+			{Offset: 1, Length: 2},
+		},
+		PositiveBuckets: []int64{int64(i + 1), 1, -1, 0},
+		NegativeSpans: []histogram.Span{
+			{Offset: 0, Length: 2},
+		},
+		NegativeBuckets: []int64{int64(i + 1), 0},
+	}
+}
+
+func tsdbutilFloatHistogram(i int) *histogram.FloatHistogram {
+	return tsdbutilHistogram(i).ToFloat(nil)
+}
+
+// chunkRowKind identifies which of tsdbutilHistogram/tsdbutilFloatHistogram/a
+// plain float a chunkRow is expected to hold, so hasLosslessChunkRoundtrip
+// can compare every decoded point against the value that was appended for
+// it instead of only checking that the bytes parse as some valid chunk.
+type chunkRowKind int
+
+const (
+	chunkRowKindFloat chunkRowKind = iota
+	chunkRowKindHistogram
+	chunkRowKindFloatHistogram
+)
+
+// hasLosslessChunkRoundtrip decodes every chunk column value in the file and,
+// for each row, asserts that its i-th decoded point equals the i-th value
+// TestConverter_NativeHistograms appended for it -- schema, zero bucket,
+// spans and deltas for histograms included -- not just that the bytes parse
+// as a structurally valid chunk.
+func hasLosslessChunkRoundtrip(pf *parquet.File, wantKinds []chunkRowKind) error {
+	rdr := parquet.NewGenericReader[chunkRow](pf)
+	defer rdr.Close()
+
+	rows := make([]chunkRow, rdr.NumRows())
+	if _, err := rdr.Read(rows); err != nil && err != io.EOF {
+		return fmt.Errorf("unable to read chunk rows: %w", err)
+	}
+	if len(rows) != len(wantKinds) {
+		return fmt.Errorf("expected %d rows, got %d", len(wantKinds), len(rows))
+	}
+
+	for ri, row := range rows {
+		i := 0
+		for _, raw := range row.Chunks {
+			c, err := decodeChunk(raw)
+			if err != nil {
+				return fmt.Errorf("unable to decode chunk: %w", err)
+			}
+			it := c.Iterator(nil)
+			for {
+				vt := it.Next()
+				if vt == chunkenc.ValNone {
+					break
+				}
+				wantTs := time.Second.Milliseconds() * int64(i+1)
+				switch wantKinds[ri] {
+				case chunkRowKindFloat:
+					if vt != chunkenc.ValFloat {
+						return fmt.Errorf("row %d point %d: expected a float value, got %s", ri, i, vt)
+					}
+					ts, v := it.At()
+					if ts != wantTs || v != float64(i) {
+						return fmt.Errorf("row %d point %d: got (%d, %v), want (%d, %v)", ri, i, ts, v, wantTs, float64(i))
+					}
+				case chunkRowKindHistogram:
+					if vt != chunkenc.ValHistogram {
+						return fmt.Errorf("row %d point %d: expected a histogram value, got %s", ri, i, vt)
+					}
+					ts, got := it.AtHistogram(nil)
+					want := tsdbutilHistogram(i)
+					if ts != wantTs || !got.Equals(want) {
+						return fmt.Errorf("row %d point %d: histogram did not round-trip losslessly: got %+v, want %+v", ri, i, got, want)
+					}
+				case chunkRowKindFloatHistogram:
+					if vt != chunkenc.ValFloatHistogram {
+						return fmt.Errorf("row %d point %d: expected a float histogram value, got %s", ri, i, vt)
+					}
+					ts, got := it.AtFloatHistogram(nil)
+					want := tsdbutilFloatHistogram(i)
+					if ts != wantTs || !got.Equals(want) {
+						return fmt.Errorf("row %d point %d: float histogram did not round-trip losslessly: got %+v, want %+v", ri, i, got, want)
+					}
+				}
+				i++
+			}
+			if err := it.Err(); err != nil {
+				return fmt.Errorf("chunk did not decode losslessly: %w", err)
+			}
+		}
+		if i != 10 {
+			return fmt.Errorf("row %d: expected 10 points, decoded %d", ri, i)
+		}
+	}
+	return nil
+}
+
+// chunkRow mirrors the projection we need out of the chunks parquet file to
+// exercise decodeChunk directly against what was written: each row is one
+// series, holding all of its encoded chunks.
+type chunkRow struct {
+	Chunks [][]byte `parquet:"chunks"`
+}
+
+func TestConverter_BloomFilters(t *testing.T) {
+	st := teststorage.New(t)
+	t.Cleanup(func() { _ = st.Close() })
+
+	bkt, err := filesystem.NewBucket(t.TempDir())
+	if err != nil {
+		t.Fatalf("unable to create bucket: %s", err)
+	}
+	t.Cleanup(func() { _ = bkt.Close() })
+
+	app := st.Appender(t.Context())
+	for i := range 200 {
+		lbls := labels.FromStrings(
+			"__name__", fmt.Sprintf("foo_%d", i/10),
+			"instance", fmt.Sprintf("instance_%d", i),
+		)
+		if _, err := app.Append(0, lbls, time.Second.Milliseconds(), float64(i)); err != nil {
+			t.Fatalf("unable to append sample: %s", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatalf("unable to commit samples: %s", err)
+	}
+
+	h := st.Head()
+	d := util.BeginOfDay(time.UnixMilli(h.MinTime())).UTC()
+
+	opts := []ConvertOption{
+		SortBy(labels.MetricName),
+		BloomFilterColumns([]string{labels.MetricName, "instance"}, 10),
+	}
+	if err := ConvertTSDBBlock(t.Context(), bkt, d, []Convertible{h}, opts...); err != nil {
+		t.Fatalf("unable to convert tsdb block: %s", err)
+	}
+
+	discoverer := locate.NewDiscoverer(bkt)
+	if err := discoverer.Discover(t.Context()); err != nil {
+		t.Fatalf("unable to discover converted block: %s", err)
+	}
+	metas := discoverer.Metas()
+	meta := metas[slices.Collect(maps.Keys(metas))[0]]
+
+	wantPresent := map[string]string{
+		labels.MetricName: "foo_5",
+		"instance":        "instance_50",
+	}
+	for i := range int(meta.Shards) {
+		lf, err := loadParquetFile(t.Context(), bkt, schema.LabelsPfileNameForShard(meta.Name, i))
+		if err != nil {
+			t.Fatalf("unable to load label parquet file for shard %d: %s", i, err)
+		}
+		if err := hasExpectedBloomFilters(lf, wantPresent, "this_value_does_not_exist"); err != nil {
+			t.Fatalf("unexpected bloom filters for shard %d: %s", i, err)
+		}
+	}
+}
+
+// hasExpectedBloomFilters opens every row group of pf and checks that each
+// requested label column carries a non-empty bloom filter which reports its
+// present value as present and absentValue as absent.
+func hasExpectedBloomFilters(pf *parquet.File, present map[string]string, absentValue string) error {
+	for name, presentValue := range present {
+		col := schema.LabelNameToColumn(name)
+		lc, ok := pf.Schema().Lookup(col)
+		if !ok {
+			return fmt.Errorf("file is missing column: %s", col)
+		}
+		for _, rg := range pf.RowGroups() {
+			cc := rg.ColumnChunks()[lc.ColumnIndex]
+
+			bf := cc.BloomFilter()
+			if bf == nil || bf.Size() == 0 {
+				return fmt.Errorf("column %q has no bloom filter", col)
+			}
+
+			ok, err := bf.Check(parquet.ValueOf(presentValue))
+			if err != nil {
+				return fmt.Errorf("unable to check bloom filter for %q: %w", col, err)
+			}
+			if !ok {
+				return fmt.Errorf("bloom filter for %q reported known value %q as absent", col, presentValue)
+			}
+
+			ok, err = bf.Check(parquet.ValueOf(absentValue))
+			if err != nil {
+				return fmt.Errorf("unable to check bloom filter for %q: %w", col, err)
+			}
+			if ok {
+				return fmt.Errorf("bloom filter for %q reported synthetic value %q as present", col, absentValue)
+			}
+		}
+	}
+	return nil
+}
+
 func loadParquetFile(ctx context.Context, bkt objstore.BucketReader, name string) (*parquet.File, error) {
 	rdr, err := bkt.Get(ctx, name)
 	if err != nil {
@@ -0,0 +1,239 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache 2.0 license found in the LICENSE file or at:
+//     https://opensource.org/licenses/Apache-2.0
+
+package convert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// Resolution is the downsampling window that the converter aggregates raw
+// samples into, mirroring the 5m/1h tiers Thanos' compactor produces for
+// TSDB blocks.
+type Resolution time.Duration
+
+const (
+	ResolutionRaw Resolution = Resolution(0)
+	Resolution5m  Resolution = Resolution(5 * time.Minute)
+	Resolution1h  Resolution = Resolution(1 * time.Hour)
+)
+
+func (r Resolution) valid() bool {
+	switch r {
+	case ResolutionRaw, Resolution5m, Resolution1h:
+		return true
+	default:
+		return false
+	}
+}
+
+// ResolutionOption sets the downsampling resolution the converter aggregates
+// into. It defaults to ResolutionRaw, which writes samples unchanged.
+func ResolutionOption(r Resolution) ConvertOption {
+	return func(o *convertOpts) error {
+		if !r.valid() {
+			return fmt.Errorf("invalid resolution: %s", time.Duration(r))
+		}
+		o.resolution = r
+		return nil
+	}
+}
+
+// downsampleAppender aggregates float samples into fixed-size Resolution
+// windows, one window per call to flush.
+type downsampleAppender struct {
+	resolution time.Duration
+
+	windowStart int64
+	windowEnd   int64
+
+	count           int64
+	sum, min, max   float64
+	counterValue    float64
+	counterAccum    float64
+	counterLastVal  float64
+	haveCounterLast bool
+	haveSample      bool
+}
+
+func newDownsampleAppender(resolution time.Duration, firstTs int64) *downsampleAppender {
+	start := firstTs - firstTs%resolution.Milliseconds()
+	return &downsampleAppender{
+		resolution:  resolution,
+		windowStart: start,
+		windowEnd:   start + resolution.Milliseconds(),
+	}
+}
+
+// Add feeds a single raw sample into the current window, flushing and
+// starting a new window whenever the sample falls outside it. It applies the
+// standard Thanos counter reset correction: whenever a sample is lower than
+// the previous one, the drop is treated as a counter reset and the last value
+// before it is added back, so the aggregated counter value stays monotonic
+// across windows.
+func (d *downsampleAppender) Add(ts int64, v float64) *aggrWindow {
+	var flushed *aggrWindow
+	if d.haveSample && ts >= d.windowEnd {
+		flushed = d.flush()
+		for ts >= d.windowEnd {
+			d.windowStart = d.windowEnd
+			d.windowEnd += d.resolution.Milliseconds()
+		}
+	}
+
+	if !d.haveSample {
+		d.count, d.sum, d.min, d.max = 0, 0, v, v
+	}
+	d.count++
+	d.sum += v
+	if v < d.min {
+		d.min = v
+	}
+	if v > d.max {
+		d.max = v
+	}
+
+	if d.haveCounterLast && v < d.counterLastVal {
+		// Counter reset: the process restarted between samples. Add the
+		// last observed value back so the running counter keeps climbing
+		// instead of dipping down with the reset.
+		d.counterAccum += d.counterLastVal
+	}
+	d.counterLastVal = v
+	d.haveCounterLast = true
+	d.counterValue = d.counterAccum + v
+
+	d.haveSample = true
+	return flushed
+}
+
+// aggrWindow is one flushed downsampling window: its aligned start time and
+// the five aggregate values that get written into their own chunk columns.
+type aggrWindow struct {
+	timestamp              int64
+	count                  int64
+	sum, min, max, counter float64
+}
+
+func (d *downsampleAppender) flush() *aggrWindow {
+	if !d.haveSample {
+		return nil
+	}
+	w := &aggrWindow{
+		timestamp: d.windowStart,
+		count:     d.count,
+		sum:       d.sum,
+		min:       d.min,
+		max:       d.max,
+		counter:   d.counterValue,
+	}
+	d.haveSample = false
+	return w
+}
+
+// Flush returns the last, not yet window-boundary-triggered window, if any
+// samples were added to it.
+func (d *downsampleAppender) Flush() *aggrWindow {
+	return d.flush()
+}
+
+// allFloatChunks reports whether every chunk in raw is a plain XOR-encoded
+// float chunk. collectSeries uses this to decide whether a series is even
+// eligible for downsampling -- native histograms aren't.
+func allFloatChunks(raw []chunkenc.Chunk) bool {
+	for _, c := range raw {
+		if c.Encoding() != chunkenc.EncXOR {
+			return false
+		}
+	}
+	return true
+}
+
+// downsampleChunks aggregates every float sample across raw, in chunk order,
+// into resolution-sized windows and returns the five encoded aggregate
+// chunks (count, sum, min, max, counter) ConvertTSDBBlock writes into the
+// chunks column for a downsampled series. raw must already be ordered by
+// time and must not contain histogram chunks -- downsampling native
+// histograms isn't supported; callers should filter those out via
+// allFloatChunks before calling this.
+func downsampleChunks(raw []chunkenc.Chunk, resolution time.Duration) ([][]byte, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var (
+		da      *downsampleAppender
+		windows []*aggrWindow
+	)
+	for _, c := range raw {
+		if c.Encoding() != chunkenc.EncXOR {
+			return nil, fmt.Errorf("cannot downsample chunk encoding %s, only float chunks are supported", c.Encoding())
+		}
+		it := c.Iterator(nil)
+		for it.Next() == chunkenc.ValFloat {
+			ts, v := it.At()
+			if da == nil {
+				da = newDownsampleAppender(resolution, ts)
+			}
+			if w := da.Add(ts, v); w != nil {
+				windows = append(windows, w)
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, fmt.Errorf("unable to iterate chunk for downsampling: %w", err)
+		}
+	}
+	if da == nil {
+		return nil, nil
+	}
+	if w := da.Flush(); w != nil {
+		windows = append(windows, w)
+	}
+
+	count := chunkenc.NewXORChunk()
+	sum := chunkenc.NewXORChunk()
+	min := chunkenc.NewXORChunk()
+	max := chunkenc.NewXORChunk()
+	counter := chunkenc.NewXORChunk()
+
+	appenders := make([]chunkenc.Appender, 5)
+	for i, c := range []chunkenc.Chunk{count, sum, min, max, counter} {
+		app, err := c.Appender()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create aggregate chunk appender: %w", err)
+		}
+		appenders[i] = app
+	}
+	for _, w := range windows {
+		appenders[0].Append(w.timestamp, float64(w.count))
+		appenders[1].Append(w.timestamp, w.sum)
+		appenders[2].Append(w.timestamp, w.min)
+		appenders[3].Append(w.timestamp, w.max)
+		appenders[4].Append(w.timestamp, w.counter)
+	}
+
+	// Order is significant: readers rely on [count, sum, min, max, counter].
+	ordered := []struct {
+		typ ChunkType
+		c   chunkenc.Chunk
+	}{
+		{ChunkTypeAggrCount, count},
+		{ChunkTypeAggrSum, sum},
+		{ChunkTypeAggrMin, min},
+		{ChunkTypeAggrMax, max},
+		{ChunkTypeAggrCounter, counter},
+	}
+	encoded := make([][]byte, 0, len(ordered))
+	for _, o := range ordered {
+		b, err := encodeAggrChunk(o.typ, o.c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode aggregate chunk: %w", err)
+		}
+		encoded = append(encoded, b)
+	}
+	return encoded, nil
+}